@@ -117,6 +117,8 @@ type ClusterInfo struct {
 
 	defaultFlowControl gatewayflowcontrol.FlowControl
 	flowcontrol        *gatewayflowcontrol.FlowControls
+	// options used to create flow controls of this cluster
+	flowControlOptions []gatewayflowcontrol.Option
 	loadbalancer       sync.Map
 
 	// upstream endpoint client rest config, the host must be replaced when using it
@@ -142,8 +144,9 @@ type secureServingConfig struct {
 	verifyOptions *x509.VerifyOptions
 }
 
-// NewEmptyClusterInfo creates a empty ClusterInfo without UpstreamCluster information such as endpoints
-func NewEmptyClusterInfo(clusterName string, config *rest.Config, healthCheck EndpointHealthCheck) *ClusterInfo {
+// NewEmptyClusterInfo creates a empty ClusterInfo without UpstreamCluster information such as endpoints,
+// flowControlOptions are used to create flow controls of this cluster
+func NewEmptyClusterInfo(clusterName string, config *rest.Config, healthCheck EndpointHealthCheck, flowControlOptions ...gatewayflowcontrol.Option) *ClusterInfo {
 	clusterName = strings.ToLower(clusterName)
 	ctx, cancel := context.WithCancel(context.Background())
 	info := &ClusterInfo{
@@ -155,6 +158,7 @@ func NewEmptyClusterInfo(clusterName string, config *rest.Config, healthCheck En
 		healthCheckIntervalSeconds: 5 * time.Second,
 		defaultFlowControl:         gatewayflowcontrol.DefaultFlowControl,
 		flowcontrol:                gatewayflowcontrol.NewFlowControls(),
+		flowControlOptions:         flowControlOptions,
 		loadbalancer:               sync.Map{},
 		endpointHeathCheck:         healthCheck,
 		featuregate:                features.DefaultMutableFeatureGate.DeepCopy(),
@@ -163,14 +167,14 @@ func NewEmptyClusterInfo(clusterName string, config *rest.Config, healthCheck En
 }
 
 // CreateClusterInfo try every endpoint to find a ready endpoint, and then init rest config
-func CreateClusterInfo(cluster *proxyv1alpha1.UpstreamCluster, healthCheck EndpointHealthCheck) (*ClusterInfo, error) {
+func CreateClusterInfo(cluster *proxyv1alpha1.UpstreamCluster, healthCheck EndpointHealthCheck, flowControlOptions ...gatewayflowcontrol.Option) (*ClusterInfo, error) {
 	restconfig, err := buildClusterRESTConfig(cluster)
 	if err != nil {
 		return nil, err
 	}
 
 	klog.Infof("create valid rest config for cluster: %v", cluster.Name)
-	info := NewEmptyClusterInfo(cluster.Name, restconfig, healthCheck)
+	info := NewEmptyClusterInfo(cluster.Name, restconfig, healthCheck, flowControlOptions...)
 	err = info.Sync(cluster)
 	if err != nil {
 		return nil, err
@@ -375,27 +379,46 @@ func (c *ClusterInfo) syncFlowControlLocked(newObj proxyv1alpha1.FlowControl) {
 
 	for _, newSchema := range newObj.Schemas {
 		newset.Add(newSchema.Name) //nolint
-		oldSchema := oldMap[newSchema.Name]
+		oldSchema, existed := oldMap[newSchema.Name]
 		oldType := gatewayflowcontrol.GuessFlowControlSchemaType(oldSchema)
 		newType := gatewayflowcontrol.GuessFlowControlSchemaType(newSchema)
+		if !existed || !apiequality.Semantic.DeepEqual(oldSchema, newSchema) {
+			c.warnNegativeLimits(newSchema)
+		}
 		fc, ok := c.flowcontrol.Load(newSchema.Name)
 		if !ok || oldType != newType {
-			// flow control is not created or type changed
-			newFC := gatewayflowcontrol.NewFlowControl(newSchema)
+			// flow control is not created or type changed.
+			// A new token bucket starts full by default, so steady traffic is
+			// not rejected on transitions from Exempt to an enforcing type.
+			// An initial fill below 1 in flowControlOptions brings back a
+			// burst of rejections right after such transitions.
+			newFC := gatewayflowcontrol.NewFlowControl(newSchema, c.flowControlOptions...)
 			c.flowcontrol.Store(newSchema.Name, newFC)
+			if ok {
+				klog.Infof("[cluster info] cluster=%q flowcontrol schema=%q type changed from %v to %v, new schema %v", c.Cluster, newSchema.Name, oldType, newType, newFC.String())
+				continue
+			}
 			klog.Infof("[cluster info] cluster=%q ensure flowcontrol schema %v", c.Cluster, newFC.String())
 			continue
 		}
 		if ok {
 			switch newType {
 			case proxyv1alpha1.MaxRequestsInflight:
-				if fc.Resize(uint32(newSchema.MaxRequestsInflight.Max), 0) {
+				if fc.Resize(gatewayflowcontrol.NormalizeLimit(newSchema.MaxRequestsInflight.Max), 0) {
 					klog.Infof("[cluster info] cluster=%q resize flowcontrol schema=%q", c.Cluster, fc.String())
 				}
 			case proxyv1alpha1.TokenBucket:
-				if fc.Resize(uint32(newSchema.TokenBucket.QPS), uint32(newSchema.TokenBucket.Burst)) {
+				if fc.Resize(gatewayflowcontrol.NormalizeLimit(newSchema.TokenBucket.QPS), gatewayflowcontrol.NormalizeLimit(newSchema.TokenBucket.Burst)) {
 					klog.Infof("[cluster info] cluster=%q resize flowcontrol schema=%q", c.Cluster, fc.String())
 				}
+			case proxyv1alpha1.Exempt:
+			default:
+				// types registered by RegisterFactory can not be resized, recreate them on change
+				if !apiequality.Semantic.DeepEqual(oldSchema, newSchema) {
+					newFC := gatewayflowcontrol.NewFlowControl(newSchema, c.flowControlOptions...)
+					c.flowcontrol.Store(newSchema.Name, newFC)
+					klog.Infof("[cluster info] cluster=%q recreate flowcontrol schema %v", c.Cluster, newFC.String())
+				}
 			}
 		}
 	}
@@ -410,6 +433,20 @@ func (c *ClusterInfo) syncFlowControlLocked(newObj proxyv1alpha1.FlowControl) {
 	})
 }
 
+// warnNegativeLimits logs negative limits which are treated as 0 by flowcontrol,
+// they should have been rejected by validation.
+func (c *ClusterInfo) warnNegativeLimits(schema proxyv1alpha1.FlowControlSchema) {
+	if schema.MaxRequestsInflight != nil && schema.MaxRequestsInflight.Max < 0 {
+		klog.Warningf("[cluster info] cluster=%q flowcontrol schema=%q has negative max=%v, treat it as 0", c.Cluster, schema.Name, schema.MaxRequestsInflight.Max)
+	}
+	if schema.TokenBucket != nil && schema.TokenBucket.QPS < 0 {
+		klog.Warningf("[cluster info] cluster=%q flowcontrol schema=%q has negative qps=%v, treat it as 0", c.Cluster, schema.Name, schema.TokenBucket.QPS)
+	}
+	if schema.TokenBucket != nil && schema.TokenBucket.Burst < 0 {
+		klog.Warningf("[cluster info] cluster=%q flowcontrol schema=%q has negative burst=%v, treat it as 0", c.Cluster, schema.Name, schema.TokenBucket.Burst)
+	}
+}
+
 func (c *ClusterInfo) syncSecureServingConfigLocked(newSecureServing proxyv1alpha1.SecureServing) error {
 	oldCfg, _ := c.loadSecureServingConfig()
 	if apiequality.Semantic.DeepEqual(oldCfg.secureServing, newSecureServing) {
@@ -528,6 +565,13 @@ func (c *ClusterInfo) getFlowSchema(name string) gatewayflowcontrol.FlowControl
 	return load
 }
 
+// RangeFlowControls calls fn for each flow control of this cluster until fn
+// returns false, e.g. to dump stats of all flow controls. The default flow
+// control is not included.
+func (c *ClusterInfo) RangeFlowControls(fn func(name string, fl gatewayflowcontrol.FlowControl) bool) {
+	c.flowcontrol.Range(fn)
+}
+
 func (c *ClusterInfo) addOrUpdateEndpoint(endpoint string, disabled bool) error {
 	info, ok := c.Endpoints.Load(endpoint)
 	if ok {
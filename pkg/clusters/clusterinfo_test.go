@@ -17,10 +17,12 @@ package clusters
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/zoumo/golib/cert"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	proxyv1alpha1 "github.com/kubewharf/kubegateway/pkg/apis/proxy/v1alpha1"
@@ -307,6 +309,8 @@ func TestClusterInfo_syncFlowControlLocked(t *testing.T) {
 			},
 		},
 	}
+	exemptToTokenBucket := tokenBucket10
+	exemptToTokenBucket.Name = exempt.Name
 	type args struct {
 		clusterInfo *ClusterInfo
 		oldObj      proxyv1alpha1.FlowControl
@@ -397,6 +401,57 @@ func TestClusterInfo_syncFlowControlLocked(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name: "exempt to token bucket",
+			args: args{
+				clusterInfo: createTestClusterInfo(),
+				oldObj: proxyv1alpha1.FlowControl{
+					Schemas: []proxyv1alpha1.FlowControlSchema{
+						exempt,
+					},
+				},
+				newObj: proxyv1alpha1.FlowControl{
+					Schemas: []proxyv1alpha1.FlowControlSchema{
+						exemptToTokenBucket,
+					},
+				},
+			},
+			check: func(info *ClusterInfo) error {
+				fl, _ := info.flowcontrol.Load(exempt.Name)
+				// the new token bucket starts full, requests up to burst are not rejected
+				for i := 0; i < int(exemptToTokenBucket.TokenBucket.Burst); i++ {
+					if !fl.TryAcquire() {
+						return fmt.Errorf("request %v is rejected right after transition", i)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name: "token bucket to exempt",
+			args: args{
+				clusterInfo: createTestClusterInfo(),
+				oldObj: proxyv1alpha1.FlowControl{
+					Schemas: []proxyv1alpha1.FlowControlSchema{
+						exemptToTokenBucket,
+					},
+				},
+				newObj: proxyv1alpha1.FlowControl{
+					Schemas: []proxyv1alpha1.FlowControlSchema{
+						exempt,
+					},
+				},
+			},
+			check: func(info *ClusterInfo) error {
+				fl, _ := info.flowcontrol.Load(exempt.Name)
+				for i := 0; i < 1000; i++ {
+					if !fl.TryAcquire() {
+						return fmt.Errorf("request %v is rejected by exempt flowcontrol", i)
+					}
+				}
+				return nil
+			},
+		},
 	}
 	for i := range tests {
 		tt := tests[i]
@@ -412,6 +467,187 @@ func TestClusterInfo_syncFlowControlLocked(t *testing.T) {
 	}
 }
 
+func TestClusterInfo_syncFlowControlLocked_keepUnchanged(t *testing.T) {
+	exempt := proxyv1alpha1.FlowControlSchema{
+		Name: "exempt",
+		FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+			Exempt: &proxyv1alpha1.ExemptFlowControlSchema{},
+		},
+	}
+	maxInflight := proxyv1alpha1.FlowControlSchema{
+		Name: "exempt",
+		FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+			MaxRequestsInflight: &proxyv1alpha1.MaxRequestsInflightFlowControlSchema{
+				Max: 10,
+			},
+		},
+	}
+	// qps is 0 so that no token is refilled while the test runs
+	tokenBucket := proxyv1alpha1.FlowControlSchema{
+		Name: "tokenbucket",
+		FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+			TokenBucket: &proxyv1alpha1.TokenBucketFlowControlSchema{
+				QPS:   0,
+				Burst: 20,
+			},
+		},
+	}
+
+	info := createTestClusterInfo()
+	info.syncFlowControlLocked(proxyv1alpha1.FlowControl{
+		Schemas: []proxyv1alpha1.FlowControlSchema{exempt, tokenBucket},
+	})
+	old, _ := info.flowcontrol.Load(tokenBucket.Name)
+	old.TryAcquire()
+
+	// only the other schema is changed, the token bucket must not be rebuilt
+	info.syncFlowControlLocked(proxyv1alpha1.FlowControl{
+		Schemas: []proxyv1alpha1.FlowControlSchema{maxInflight, tokenBucket},
+	})
+	got, _ := info.flowcontrol.Load(tokenBucket.Name)
+	if got != old {
+		t.Errorf("token bucket is rebuilt although its schema is not changed")
+	}
+	if want := tokenBucket.TokenBucket.Burst - 1; got.Available() != want {
+		t.Errorf("token bucket lost its tokens, available=%v, want %v", got.Available(), want)
+	}
+}
+
+func TestClusterInfo_syncFlowControlLocked_releaseAfterSwap(t *testing.T) {
+	schema := func(config proxyv1alpha1.FlowControlSchemaConfiguration) proxyv1alpha1.FlowControl {
+		return proxyv1alpha1.FlowControl{
+			Schemas: []proxyv1alpha1.FlowControlSchema{{Name: "limit", FlowControlSchemaConfiguration: config}},
+		}
+	}
+	reserve := func(info *ClusterInfo) (flowcontrol.FlowControl, flowcontrol.Reservation) {
+		fc := info.getFlowSchema("limit")
+		r := fc.Reserve()
+		if !r.OK() {
+			t.Fatalf("request should be admitted by %v", fc.String())
+		}
+		r.Commit()
+		return fc, r
+	}
+
+	info := createTestClusterInfo()
+	info.syncFlowControlLocked(schema(proxyv1alpha1.FlowControlSchemaConfiguration{
+		MaxRequestsInflight: &proxyv1alpha1.MaxRequestsInflightFlowControlSchema{Max: 2},
+	}))
+	first, r1 := reserve(info)
+
+	// type changes while r1 is inflight, the limiter is rebuilt
+	info.syncFlowControlLocked(schema(proxyv1alpha1.FlowControlSchemaConfiguration{
+		TokenBucket: &proxyv1alpha1.TokenBucketFlowControlSchema{QPS: 0, Burst: 1},
+	}))
+	second, r2 := reserve(info)
+	if second == first {
+		t.Fatalf("limiter should be rebuilt on type change")
+	}
+
+	// type changes back while r1 and r2 are inflight
+	info.syncFlowControlLocked(schema(proxyv1alpha1.FlowControlSchemaConfiguration{
+		MaxRequestsInflight: &proxyv1alpha1.MaxRequestsInflightFlowControlSchema{Max: 1},
+	}))
+	third, r3 := reserve(info)
+	if third == first || third == second {
+		t.Fatalf("limiter should be rebuilt on type change")
+	}
+
+	check := func(step string, wantFirst, wantSecond, wantThird int32) {
+		if got := first.Available(); got != wantFirst {
+			t.Errorf("%v: first limiter Available() = %v, want %v", step, got, wantFirst)
+		}
+		if got := second.Available(); got != wantSecond {
+			t.Errorf("%v: second limiter Available() = %v, want %v", step, got, wantSecond)
+		}
+		if got := third.Available(); got != wantThird {
+			t.Errorf("%v: third limiter Available() = %v, want %v", step, got, wantThird)
+		}
+	}
+	check("all inflight", 1, 0, 0)
+
+	// r1 is released against the limiter which admitted it, it must not
+	// free the slot of the current limiter
+	if !r1.Release() {
+		t.Errorf("r1.Release() = false, want true")
+	}
+	check("r1 released", 2, 0, 0)
+	if info.getFlowSchema("limit").Reserve().OK() {
+		t.Errorf("current limiter should still be full after r1 is released")
+	}
+
+	// tokens of a token bucket are consumed, release does not return them
+	if !r2.Release() {
+		t.Errorf("r2.Release() = false, want true")
+	}
+	check("r2 released", 2, 0, 0)
+
+	if !r3.Release() {
+		t.Errorf("r3.Release() = false, want true")
+	}
+	check("r3 released", 2, 0, 1)
+}
+
+func TestClusterInfo_syncFlowControlLocked_transitionUnderLoad(t *testing.T) {
+	exempt := proxyv1alpha1.FlowControl{
+		Schemas: []proxyv1alpha1.FlowControlSchema{{
+			Name: "limit",
+			FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+				Exempt: &proxyv1alpha1.ExemptFlowControlSchema{},
+			},
+		}},
+	}
+	tokenBucket := proxyv1alpha1.FlowControl{
+		Schemas: []proxyv1alpha1.FlowControlSchema{{
+			Name: "limit",
+			FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+				TokenBucket: &proxyv1alpha1.TokenBucketFlowControlSchema{QPS: 100, Burst: 100},
+			},
+		}},
+	}
+
+	fakeClock := clock.NewFakeClock(time.Now())
+	info, err := CreateClusterInfo(newTestUpstreamClusterConfig(), alwaysReadyHealthCheck, flowcontrol.WithClock(fakeClock))
+	if err != nil {
+		t.Fatalf("CreateClusterInfo() error = %v", err)
+	}
+	// drive load for duration, perStep requests every 10ms, and return rejected requests
+	drive := func(duration time.Duration, perStep int) (total, rejected int) {
+		for elapsed := time.Duration(0); elapsed < duration; elapsed += 10 * time.Millisecond {
+			fakeClock.Step(10 * time.Millisecond)
+			for i := 0; i < perStep; i++ {
+				total++
+				if !info.getFlowSchema("limit").TryAcquire() {
+					rejected++
+				}
+			}
+		}
+		return total, rejected
+	}
+
+	info.syncFlowControlLocked(exempt)
+	if _, rejected := drive(time.Second, 1); rejected != 0 {
+		t.Errorf("exempt rejected %v requests", rejected)
+	}
+
+	// steady traffic at the limit keeps flowing right after exempt to token bucket
+	info.syncFlowControlLocked(tokenBucket)
+	if _, rejected := drive(2*time.Second, 1); rejected != 0 {
+		t.Errorf("traffic at the limit: %v requests are rejected after exempt to token bucket", rejected)
+	}
+	// traffic over the limit is shaped, only the over-limit portion is rejected
+	total, rejected := drive(2*time.Second, 2)
+	if overLimit := total - 2*100; rejected == 0 || rejected > overLimit {
+		t.Errorf("traffic over the limit: %v of %v requests are rejected, want between 1 and %v", rejected, total, overLimit)
+	}
+
+	// nothing is rejected right after token bucket to exempt
+	info.syncFlowControlLocked(exempt)
+	if _, rejected := drive(10*time.Millisecond, 1000); rejected != 0 {
+		t.Errorf("%v requests are rejected after token bucket to exempt", rejected)
+	}
+}
+
 func TestClusterInfo_sync(t *testing.T) {
 	a := proxyv1alpha1.SecureServing{}
 	b := proxyv1alpha1.SecureServing{}
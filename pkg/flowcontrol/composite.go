@@ -0,0 +1,216 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowcontrol
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+type CompositeMode string
+
+const (
+	// CompositeAnd admits a request only if all children admit it
+	CompositeAnd CompositeMode = "And"
+	// CompositeOr admits a request if any child admits it
+	CompositeOr CompositeMode = "Or"
+)
+
+// NewCompositeFlowControl returns a FlowControl which combines children
+// with the given mode, e.g. "max 100 inflight AND 500 QPS".
+//
+// In Or mode a plain Release can not tell which child admitted the
+// request, so requests must be admitted by Reserve and released by
+// Reservation.Release. TryAcquire always rejects with ReservationRequired
+// in Or mode. The same applies to an And composite with an Or descendant.
+func NewCompositeFlowControl(name string, mode CompositeMode, children ...FlowControl) FlowControl {
+	return &compositeFlowControl{
+		name:     name,
+		mode:     mode,
+		children: children,
+	}
+}
+
+type compositeFlowControl struct {
+	name     string
+	mode     CompositeMode
+	children []FlowControl
+}
+
+func (f *compositeFlowControl) TryAcquire() bool {
+	ok, _ := f.TryAcquireDetailed()
+	return ok
+}
+
+// TryAcquireDetailed returns the reason of the child which rejects the
+// request in And mode. It always rejects if the composite requires
+// reservation, use Reserve instead.
+func (f *compositeFlowControl) TryAcquireDetailed() (bool, RejectReason) {
+	if f.requiresReservation() {
+		return false, ReservationRequired
+	}
+	r := f.Reserve()
+	r.Commit()
+	return r.OK(), r.Reason()
+}
+
+// requiresReservation returns true if the composite is in Or mode or has
+// an Or descendant, a plain Release can not release them correctly.
+func (f *compositeFlowControl) requiresReservation() bool {
+	if f.mode == CompositeOr {
+		return true
+	}
+	for _, child := range f.children {
+		if c, ok := child.(*compositeFlowControl); ok && c.requiresReservation() {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *compositeFlowControl) Reserve() Reservation {
+	if f.mode == CompositeOr {
+		return f.reserveAny()
+	}
+	return f.reserveAll()
+}
+
+func (f *compositeFlowControl) reserveAll() Reservation {
+	reservations := make([]Reservation, 0, len(f.children))
+	for _, child := range f.children {
+		r := child.Reserve()
+		if !r.OK() {
+			// give back tokens taken from previous children
+			for _, taken := range reservations {
+				taken.Cancel()
+			}
+			return r
+		}
+		reservations = append(reservations, r)
+	}
+	result := newReservation(
+		func() {
+			for _, r := range reservations {
+				r.Cancel()
+			}
+		},
+		func() {
+			for _, r := range reservations {
+				r.Release()
+			}
+		},
+	)
+	result.commit = func() {
+		for _, r := range reservations {
+			r.Commit()
+		}
+	}
+	return result
+}
+
+func (f *compositeFlowControl) reserveAny() Reservation {
+	rejected := inflightExceededReservation
+	for _, child := range f.children {
+		r := child.Reserve()
+		if !r.OK() {
+			rejected = r
+			continue
+		}
+		// the reservation releases the exact child which admits the request
+		return r
+	}
+	return rejected
+}
+
+// Release releases all children in And mode. It is ignored if the
+// composite requires reservation, because no request can be admitted by
+// TryAcquire then.
+func (f *compositeFlowControl) Release() {
+	if f.requiresReservation() {
+		klog.Warningf("[flowcontrol] name=%q release is not supported in %v mode, use Reservation.Release instead", f.name, f.mode)
+		return
+	}
+	for _, child := range f.children {
+		child.Release()
+	}
+}
+
+// Available returns the minimum available of children in And mode, and
+// the sum of them in Or mode.
+func (f *compositeFlowControl) Available() int32 {
+	var result int32 = -1
+	for _, child := range f.children {
+		available := child.Available()
+		if f.mode == CompositeOr {
+			if available < 0 {
+				// any unlimited child makes the composite unlimited
+				return -1
+			}
+			if result < 0 {
+				result = 0
+			}
+			result += available
+			continue
+		}
+		if available >= 0 && (result < 0 || available < result) {
+			result = available
+		}
+	}
+	return result
+}
+
+// ConfiguredQPS is not supported by composite flow control, read children instead.
+func (f *compositeFlowControl) ConfiguredQPS() (int32, bool) {
+	return 0, false
+}
+
+// ConfiguredBurst is not supported by composite flow control, read children instead.
+func (f *compositeFlowControl) ConfiguredBurst() (int32, bool) {
+	return 0, false
+}
+
+// ConfiguredMaxInflight is not supported by composite flow control, read children instead.
+func (f *compositeFlowControl) ConfiguredMaxInflight() (int32, bool) {
+	return 0, false
+}
+
+// WarmingUp returns true if any child is warming up.
+func (f *compositeFlowControl) WarmingUp() bool {
+	for _, child := range f.children {
+		if child.WarmingUp() {
+			return true
+		}
+	}
+	return false
+}
+
+// Resize is not supported by composite flow control, resize children instead.
+func (f *compositeFlowControl) Resize(n uint32, burst uint32) bool {
+	return false
+}
+
+func (f *compositeFlowControl) Name() string {
+	return f.name
+}
+
+func (f *compositeFlowControl) String() string {
+	children := make([]string, 0, len(f.children))
+	for _, child := range f.children {
+		children = append(children, "{"+child.String()+"}")
+	}
+	return fmt.Sprintf("name=%v,type=Composite,mode=%v,children=[%v]", f.name, f.mode, strings.Join(children, ","))
+}
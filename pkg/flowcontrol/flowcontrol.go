@@ -17,9 +17,10 @@ package flowcontrol
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/zoumo/golib/lock/maxinflight"
-	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog"
 
 	proxyv1alpha1 "github.com/kubewharf/kubegateway/pkg/apis/proxy/v1alpha1"
 )
@@ -50,6 +51,15 @@ func (f *FlowControls) Delete(name string) {
 	f.data.Delete(name)
 }
 
+// Range calls fn for each flow control until fn returns false. No lock is
+// held while calling fn, so fn can Load, Store or Delete flow controls, but
+// it may or may not see changes made during the iteration.
+func (f *FlowControls) Range(fn func(name string, fl FlowControl) bool) {
+	f.data.Range(func(key, value interface{}) bool {
+		return fn(key.(string), value.(FlowControl))
+	})
+}
+
 func (f *FlowControls) Len() int {
 	length := 0
 	f.data.Range(func(key, value interface{}) bool {
@@ -63,10 +73,33 @@ type FlowControl interface {
 	// TryAccept returns true if a token is taken immediately. Otherwise,
 	// it returns false.
 	TryAcquire() bool
+	// TryAcquireDetailed is the same as TryAcquire, but it also returns
+	// the reason if the request is rejected.
+	TryAcquireDetailed() (bool, RejectReason)
+	// Reserve takes a token like TryAcquire, but the token can be given
+	// back by Reservation.Cancel if the request is not forwarded at last.
+	Reserve() Reservation
 	// Release add a token back to the lock
 	Release()
 	// Resize changes the max in flight lock's capacity
 	Resize(n uint32, burst uint32) bool
+	// Available returns remaining tokens of token bucket or free slots of
+	// max requests inflight. It returns -1 if the flow control is not limited.
+	Available() int32
+	// ConfiguredQPS returns the configured qps, ok is false if the flow
+	// control is not a token bucket.
+	ConfiguredQPS() (qps int32, ok bool)
+	// ConfiguredBurst returns the configured burst, ok is false if the flow
+	// control is not a token bucket.
+	ConfiguredBurst() (burst int32, ok bool)
+	// ConfiguredMaxInflight returns the configured max requests inflight,
+	// ok is false if the flow control is not a max requests inflight.
+	ConfiguredMaxInflight() (max int32, ok bool)
+	// WarmingUp returns true if the flow control is ramping up to a higher
+	// limit after Resize, see WithWarmup.
+	WarmingUp() bool
+	// Name returns the name of flow control schema.
+	Name() string
 	// String returns human readable string.
 	String() string
 }
@@ -80,7 +113,12 @@ var (
 	})
 )
 
+// GuessFlowControlSchemaType returns the type of schema. Types registered by
+// RegisterFactory are checked before built-in types.
 func GuessFlowControlSchemaType(config proxyv1alpha1.FlowControlSchema) proxyv1alpha1.FlowControlSchemaType {
+	if r, ok := matchRegisteredType(config); ok {
+		return r.typ
+	}
 	switch {
 	case config.Exempt != nil:
 		return proxyv1alpha1.Exempt
@@ -92,30 +130,51 @@ func GuessFlowControlSchemaType(config proxyv1alpha1.FlowControlSchema) proxyv1a
 	return proxyv1alpha1.Exempt
 }
 
-func NewFlowControl(schema proxyv1alpha1.FlowControlSchema) FlowControl {
+// NormalizeLimit converts a limit in schema to uint32. Negative values are
+// rejected by validation, but if one still gets here it is treated as 0
+// instead of wrapping around to a huge limit. A max inflight or burst of 0
+// blocks all requests, and a qps of 0 never refills the token bucket.
+func NormalizeLimit(v int32) uint32 {
+	if v < 0 {
+		return 0
+	}
+	return uint32(v)
+}
+
+// NewFlowControl creates a FlowControl for schema. Schemas of a type
+// registered by RegisterFactory are created by its factory. A token bucket
+// starts full unless WithInitialFill is given.
+func NewFlowControl(schema proxyv1alpha1.FlowControlSchema, opts ...Option) FlowControl {
+	if r, ok := matchRegisteredType(schema); ok {
+		return r.factory(schema, opts...)
+	}
+	o := newOptions(opts...)
 	name := schema.Name
 	typ := GuessFlowControlSchemaType(schema)
 	switch typ {
 	case proxyv1alpha1.MaxRequestsInflight:
 		return &flowControl{
-			TokenBucket: maxinflight.New(uint32(schema.MaxRequestsInflight.Max)),
-			name:        name,
-			typ:         typ,
-			max:         uint32(schema.MaxRequestsInflight.Max),
+			TokenBucket:        maxinflight.New(NormalizeLimit(schema.MaxRequestsInflight.Max)),
+			name:               name,
+			typ:                typ,
+			max:                NormalizeLimit(schema.MaxRequestsInflight.Max),
+			onUnmatchedRelease: o.onUnmatchedRelease,
 		}
 	case proxyv1alpha1.TokenBucket:
 		return &resizeableTokenBucket{
-			rateLimiter: flowcontrol.NewTokenBucketRateLimiter(float32(schema.TokenBucket.QPS), int(schema.TokenBucket.Burst)),
-			name:        name,
-			typ:         typ,
-			qps:         uint32(schema.TokenBucket.QPS),
-			burst:       uint32(schema.TokenBucket.Burst),
+			rateLimiter:   newTokenBucket(float64(NormalizeLimit(schema.TokenBucket.QPS)), int(NormalizeLimit(schema.TokenBucket.Burst)), o),
+			name:          name,
+			typ:           typ,
+			qps:           NormalizeLimit(schema.TokenBucket.QPS),
+			burst:         NormalizeLimit(schema.TokenBucket.Burst),
+			topUpOnGrowth: o.topUpOnGrowth,
 		}
 	}
 	return &flowControl{
-		TokenBucket: maxinflight.InfinityTokenBucket,
-		name:        name,
-		typ:         typ,
+		TokenBucket:        maxinflight.InfinityTokenBucket,
+		name:               name,
+		typ:                typ,
+		onUnmatchedRelease: o.onUnmatchedRelease,
 	}
 }
 
@@ -124,47 +183,191 @@ type flowControl struct {
 	name string
 	typ  proxyv1alpha1.FlowControlSchemaType
 	max  uint32
+	// inflight counts acquired tokens which are not released yet
+	inflight int32
+	// onUnmatchedRelease is set by WithUnmatchedReleaseHandler
+	onUnmatchedRelease func(name string)
+}
+
+func (f *flowControl) TryAcquire() bool {
+	if f.typ == proxyv1alpha1.MaxRequestsInflight && atomic.LoadUint32(&f.max) == 0 {
+		// max inflight of 0 blocks all requests
+		return false
+	}
+	if !f.TokenBucket.TryAcquire() {
+		return false
+	}
+	atomic.AddInt32(&f.inflight, 1)
+	return true
+}
+
+// Release ignores calls without a matching acquire so that inflight never
+// drops below zero and the token bucket never grows beyond max.
+func (f *flowControl) Release() {
+	for {
+		inflight := atomic.LoadInt32(&f.inflight)
+		if inflight <= 0 {
+			klog.Warningf("[flowcontrol] name=%q release is called without a matching acquire, ignore it", f.name)
+			if f.onUnmatchedRelease != nil {
+				f.onUnmatchedRelease(f.name)
+			}
+			return
+		}
+		if atomic.CompareAndSwapInt32(&f.inflight, inflight, inflight-1) {
+			break
+		}
+	}
+	f.TokenBucket.Release()
+}
+
+func (f *flowControl) Available() int32 {
+	if f.typ != proxyv1alpha1.MaxRequestsInflight {
+		return -1
+	}
+	available := int32(atomic.LoadUint32(&f.max)) - atomic.LoadInt32(&f.inflight)
+	if available < 0 {
+		// max is shrunk below current inflight
+		return 0
+	}
+	return available
+}
+
+func (f *flowControl) ConfiguredQPS() (int32, bool) {
+	return 0, false
+}
+
+func (f *flowControl) ConfiguredBurst() (int32, bool) {
+	return 0, false
+}
+
+func (f *flowControl) ConfiguredMaxInflight() (int32, bool) {
+	if f.typ != proxyv1alpha1.MaxRequestsInflight {
+		return 0, false
+	}
+	return int32(atomic.LoadUint32(&f.max)), true
+}
+
+func (f *flowControl) WarmingUp() bool {
+	return false
+}
+
+func (f *flowControl) Name() string {
+	return f.name
 }
 
 func (f *flowControl) String() string {
-	return fmt.Sprintf("name=%v,type=%v,size=%v", f.name, f.typ, f.max)
+	return fmt.Sprintf("name=%v,type=%v,size=%v", f.name, f.typ, atomic.LoadUint32(&f.max))
+}
+
+func (f *flowControl) TryAcquireDetailed() (bool, RejectReason) {
+	if !f.TryAcquire() {
+		return false, LocalInflightExceeded
+	}
+	return true, NotRejected
+}
+
+func (f *flowControl) Reserve() Reservation {
+	if !f.TryAcquire() {
+		return inflightExceededReservation
+	}
+	return newReservation(f.Release, f.Release)
 }
 
 func (f *flowControl) Resize(n uint32, burst uint32) bool {
 	resized := false
-	if f.max != n {
+	if atomic.LoadUint32(&f.max) != n {
 		f.TokenBucket.Resize(n)
-		f.max = n
+		atomic.StoreUint32(&f.max, n)
 		resized = true
 	}
 	return resized
 }
 
 type resizeableTokenBucket struct {
-	rateLimiter flowcontrol.RateLimiter
-	name        string
-	typ         proxyv1alpha1.FlowControlSchemaType
-	qps         uint32
-	burst       uint32
+	rateLimiter   *tokenBucket
+	name          string
+	typ           proxyv1alpha1.FlowControlSchemaType
+	qps           uint32
+	burst         uint32
+	topUpOnGrowth bool
 }
 
 func (f *resizeableTokenBucket) TryAcquire() bool {
-	return f.rateLimiter.TryAccept()
+	return f.rateLimiter.TryAcquire()
+}
+
+func (f *resizeableTokenBucket) TryAcquireDetailed() (bool, RejectReason) {
+	if !f.rateLimiter.TryAcquire() {
+		return false, LocalRateExceeded
+	}
+	return true, NotRejected
+}
+
+func (f *resizeableTokenBucket) Reserve() Reservation {
+	if !f.rateLimiter.TryAcquire() {
+		return rateExceededReservation
+	}
+	return newReservation(f.rateLimiter.Return, f.Release)
+}
+
+func (f *resizeableTokenBucket) Available() int32 {
+	return f.rateLimiter.Available()
+}
+
+func (f *resizeableTokenBucket) ConfiguredQPS() (int32, bool) {
+	return int32(atomic.LoadUint32(&f.qps)), true
+}
+
+func (f *resizeableTokenBucket) ConfiguredBurst() (int32, bool) {
+	return int32(atomic.LoadUint32(&f.burst)), true
+}
+
+func (f *resizeableTokenBucket) ConfiguredMaxInflight() (int32, bool) {
+	return 0, false
+}
+
+func (f *resizeableTokenBucket) WarmingUp() bool {
+	return f.rateLimiter.WarmingUp()
+}
+
+func (f *resizeableTokenBucket) Name() string {
+	return f.name
 }
 
 func (f *resizeableTokenBucket) String() string {
-	return fmt.Sprintf("name=%v,type=%v,qps=%v,burst=%v", f.name, f.typ, f.qps, f.burst)
+	return fmt.Sprintf("name=%v,type=%v,qps=%v,burst=%v", f.name, f.typ, atomic.LoadUint32(&f.qps), atomic.LoadUint32(&f.burst))
 }
 
+// Resize changes qps and burst in place, only the changed one is applied
+// so that tokens accrued so far are not lost.
 func (f *resizeableTokenBucket) Resize(n uint32, burst uint32) bool {
-	resized := false
-	if f.qps != n || f.burst != burst {
-		f.rateLimiter = flowcontrol.NewTokenBucketRateLimiter(float32(n), int(burst))
-		f.qps = n
-		f.burst = burst
-		resized = true
+	qpsResized := f.ResizeQPS(n)
+	burstResized := f.ResizeBurst(burst)
+	return qpsResized || burstResized
+}
+
+// ResizeQPS changes the refill rate without touching burst.
+func (f *resizeableTokenBucket) ResizeQPS(n uint32) bool {
+	if atomic.LoadUint32(&f.qps) == n {
+		return false
 	}
-	return resized
+	f.rateLimiter.SetQPS(float64(n))
+	atomic.StoreUint32(&f.qps, n)
+	return true
+}
+
+// ResizeBurst changes the capacity of bucket without touching qps.
+func (f *resizeableTokenBucket) ResizeBurst(burst uint32) bool {
+	old := atomic.LoadUint32(&f.burst)
+	if old == burst {
+		return false
+	}
+	f.rateLimiter.SetBurst(int(burst))
+	if f.topUpOnGrowth && burst > old {
+		f.rateLimiter.Fill()
+	}
+	atomic.StoreUint32(&f.burst, burst)
+	return true
 }
 
 func (f *resizeableTokenBucket) Release() {
@@ -0,0 +1,670 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowcontrol
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	proxyv1alpha1 "github.com/kubewharf/kubegateway/pkg/apis/proxy/v1alpha1"
+)
+
+func newMaxInflightSchema(max int32) proxyv1alpha1.FlowControlSchema {
+	return proxyv1alpha1.FlowControlSchema{
+		Name: "max-inflight",
+		FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+			MaxRequestsInflight: &proxyv1alpha1.MaxRequestsInflightFlowControlSchema{
+				Max: max,
+			},
+		},
+	}
+}
+
+func newTokenBucketSchema(qps, burst int32) proxyv1alpha1.FlowControlSchema {
+	return proxyv1alpha1.FlowControlSchema{
+		Name: "tokenbucket",
+		FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+			TokenBucket: &proxyv1alpha1.TokenBucketFlowControlSchema{
+				QPS:   qps,
+				Burst: burst,
+			},
+		},
+	}
+}
+
+func TestFlowControl_Reserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema proxyv1alpha1.FlowControlSchema
+	}{
+		{
+			name:   "max inflight",
+			schema: newMaxInflightSchema(1),
+		},
+		{
+			// use a tiny qps so that tokens are not refilled during test
+			name:   "token bucket",
+			schema: newTokenBucketSchema(0, 1),
+		},
+	}
+	for i := range tests {
+		tt := tests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			fc := NewFlowControl(tt.schema)
+
+			r := fc.Reserve()
+			if !r.OK() {
+				t.Fatalf("Reserve() should take the only token")
+			}
+			if fc.Reserve().OK() {
+				t.Fatalf("Reserve() should be rejected when no token is left")
+			}
+
+			// cancel gives the token back, cancel twice is a no-op
+			r.Cancel()
+			r.Cancel()
+
+			r = fc.Reserve()
+			if !r.OK() {
+				t.Fatalf("Reserve() should succeed after the previous reservation is canceled")
+			}
+			r.Commit()
+			// cancel after commit does nothing
+			r.Cancel()
+			if fc.TryAcquire() {
+				t.Fatalf("TryAcquire() should be rejected after the reservation is committed")
+			}
+		})
+	}
+}
+
+func TestCompositeFlowControl(t *testing.T) {
+	t.Run("and", func(t *testing.T) {
+		fc := NewCompositeFlowControl("and", CompositeAnd, NewFlowControl(newTokenBucketSchema(0, 2)), NewFlowControl(newMaxInflightSchema(1)))
+		if !fc.TryAcquire() {
+			t.Fatalf("first request should be admitted")
+		}
+		if fc.TryAcquire() {
+			t.Fatalf("second request should be rejected by max inflight")
+		}
+		fc.Release()
+		// the token taken by the rejected request has been given back
+		if !fc.TryAcquire() {
+			t.Fatalf("third request should be admitted")
+		}
+		fc.Release()
+		if fc.TryAcquire() {
+			t.Fatalf("fourth request should be rejected by token bucket")
+		}
+	})
+	t.Run("or", func(t *testing.T) {
+		fc := NewCompositeFlowControl("or", CompositeOr, NewFlowControl(newMaxInflightSchema(1)), NewFlowControl(newMaxInflightSchema(1)))
+		var reservations []Reservation
+		for i := 0; i < 2; i++ {
+			r := fc.Reserve()
+			if !r.OK() {
+				t.Fatalf("request %v should be admitted", i)
+			}
+			r.Commit()
+			reservations = append(reservations, r)
+		}
+		if fc.Reserve().OK() {
+			t.Fatalf("request should be rejected when all children are full")
+		}
+		for _, r := range reservations {
+			r.Release()
+		}
+		for i := 0; i < 2; i++ {
+			r := fc.Reserve()
+			if !r.OK() {
+				t.Fatalf("request %v should be admitted after release", i)
+			}
+			r.Commit()
+		}
+	})
+	t.Run("or rejects TryAcquire", func(t *testing.T) {
+		child := NewFlowControl(newMaxInflightSchema(1))
+		fc := NewCompositeFlowControl("or", CompositeOr, child)
+		if ok, reason := fc.TryAcquireDetailed(); ok || reason != ReservationRequired {
+			t.Errorf("TryAcquireDetailed() = (%v, %v), want (false, %v)", ok, reason, ReservationRequired)
+		}
+		r := fc.Reserve()
+		r.Commit()
+		// plain Release must not free the slot taken by the reservation
+		fc.Release()
+		if got := child.Available(); got != 0 {
+			t.Errorf("child Available() after plain Release = %v, want 0", got)
+		}
+	})
+	t.Run("and with or child rejects TryAcquire", func(t *testing.T) {
+		child := NewFlowControl(newMaxInflightSchema(1))
+		fc := NewCompositeFlowControl("and", CompositeAnd, NewCompositeFlowControl("or", CompositeOr, child))
+		for i := 0; i < 3; i++ {
+			if ok, reason := fc.TryAcquireDetailed(); ok || reason != ReservationRequired {
+				t.Fatalf("TryAcquireDetailed() = (%v, %v), want (false, %v)", ok, reason, ReservationRequired)
+			}
+			fc.Release()
+			if got := child.Available(); got != 1 {
+				t.Fatalf("child Available() after %v rounds = %v, want 1", i, got)
+			}
+		}
+		r := fc.Reserve()
+		if !r.OK() {
+			t.Fatalf("Reserve() should be admitted")
+		}
+		r.Commit()
+		r.Release()
+		if got := child.Available(); got != 1 {
+			t.Errorf("child Available() after Reservation.Release = %v, want 1", got)
+		}
+	})
+	t.Run("or finishes out of order", func(t *testing.T) {
+		first := NewFlowControl(newMaxInflightSchema(1))
+		second := NewFlowControl(newMaxInflightSchema(1))
+		fc := NewCompositeFlowControl("or", CompositeOr, first, second)
+		r1 := fc.Reserve()
+		r1.Commit()
+		r2 := fc.Reserve()
+		r2.Commit()
+		// the request admitted by second finishes while first is still running
+		r2.Release()
+		if first.Available() != 0 || second.Available() != 1 {
+			t.Fatalf("second should be released, got first=%v, second=%v", first.Available(), second.Available())
+		}
+		r3 := fc.Reserve()
+		r3.Commit()
+		if first.Available() != 0 || second.Available() != 0 {
+			t.Fatalf("new request should be admitted by second, got first=%v, second=%v", first.Available(), second.Available())
+		}
+		if fc.Reserve().OK() {
+			t.Fatalf("first must not admit beyond its max")
+		}
+		r1.Release()
+		r3.Release()
+		if first.Available() != 1 || second.Available() != 1 {
+			t.Errorf("all slots should be free, got first=%v, second=%v", first.Available(), second.Available())
+		}
+	})
+}
+
+func TestFlowControl_Available(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema proxyv1alpha1.FlowControlSchema
+		want   []int32
+	}{
+		{
+			name:   "max inflight",
+			schema: newMaxInflightSchema(2),
+			want:   []int32{2, 1, 0},
+		},
+		{
+			name:   "token bucket",
+			schema: newTokenBucketSchema(0, 2),
+			want:   []int32{2, 1, 0},
+		},
+		{
+			name:   "exempt",
+			schema: proxyv1alpha1.FlowControlSchema{Name: "exempt"},
+			want:   []int32{-1, -1, -1},
+		},
+	}
+	for i := range tests {
+		tt := tests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			fc := NewFlowControl(tt.schema)
+			for i, want := range tt.want {
+				if got := fc.Available(); got != want {
+					t.Errorf("Available() after %v acquires = %v, want %v", i, got, want)
+				}
+				fc.TryAcquire()
+			}
+		})
+	}
+}
+
+func TestResizeableTokenBucket_Resize(t *testing.T) {
+	fc := NewFlowControl(newTokenBucketSchema(0, 10))
+	for i := 0; i < 5; i++ {
+		fc.TryAcquire()
+	}
+
+	tests := []struct {
+		name  string
+		qps   uint32
+		burst uint32
+		want  int32
+	}{
+		{
+			name:  "burst grows",
+			qps:   0,
+			burst: 20,
+			want:  5,
+		},
+		{
+			name:  "qps changes",
+			qps:   1,
+			burst: 20,
+			want:  5,
+		},
+		{
+			name:  "burst shrinks below tokens",
+			qps:   1,
+			burst: 3,
+			want:  3,
+		},
+	}
+	for _, tt := range tests {
+		if !fc.Resize(tt.qps, tt.burst) {
+			t.Errorf("%v: Resize() = false, want true", tt.name)
+		}
+		if got := fc.Available(); got != tt.want {
+			t.Errorf("%v: Available() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if fc.Resize(1, 3) {
+		t.Errorf("Resize() with unchanged qps and burst = true, want false")
+	}
+}
+
+func TestResizeableTokenBucket_ResizeBurstKeepsAccrual(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	fc := NewFlowControl(newTokenBucketSchema(10, 100), WithClock(fakeClock), WithInitialFill(0))
+	fakeClock.Step(time.Second)
+	if got := fc.Available(); got != 10 {
+		t.Fatalf("Available() after 1s = %v, want 10", got)
+	}
+
+	// sustained load takes one token every 100ms, which equals the refill rate
+	for i := 0; i < 20; i++ {
+		switch i {
+		case 5:
+			if !fc.Resize(10, 50) {
+				t.Fatalf("Resize() burst shrink = false, want true")
+			}
+		case 15:
+			if !fc.Resize(10, 200) {
+				t.Fatalf("Resize() burst grow = false, want true")
+			}
+		}
+		fakeClock.Step(100 * time.Millisecond)
+		if !fc.TryAcquire() {
+			t.Fatalf("request %v should be admitted under sustained load", i)
+		}
+	}
+	if got := fc.Available(); got != 10 {
+		t.Errorf("Available() after burst-only resizes = %v, want 10", got)
+	}
+	// tokens keep accruing at the unchanged qps
+	fakeClock.Step(time.Second)
+	if got := fc.Available(); got != 20 {
+		t.Errorf("Available() 1s after burst-only resizes = %v, want 20", got)
+	}
+}
+
+func TestRegisterFactory(t *testing.T) {
+	typ := proxyv1alpha1.FlowControlSchemaType("TestRegisterFactory")
+	match := func(schema proxyv1alpha1.FlowControlSchema) bool {
+		return schema.Name == "custom"
+	}
+	var gotOpts int
+	factory := func(schema proxyv1alpha1.FlowControlSchema, opts ...Option) FlowControl {
+		gotOpts = len(opts)
+		return NewCompositeFlowControl(schema.Name, CompositeAnd, NewFlowControl(newMaxInflightSchema(1), opts...))
+	}
+	if err := RegisterFactory(typ, match, factory); err != nil {
+		t.Fatalf("RegisterFactory() error = %v", err)
+	}
+	t.Cleanup(func() {
+		unregisterFactory(typ)
+	})
+
+	custom := newMaxInflightSchema(10)
+	custom.Name = "custom"
+	if got := GuessFlowControlSchemaType(custom); got != typ {
+		t.Errorf("GuessFlowControlSchemaType() = %v, want %v", got, typ)
+	}
+	fc := NewFlowControl(custom, WithInitialFill(0))
+	if fc.Name() != "custom" || fc.Available() != 1 {
+		t.Errorf("NewFlowControl() = %v, want the flow control created by factory", fc)
+	}
+	if gotOpts != 1 {
+		t.Errorf("factory got %v options, want 1", gotOpts)
+	}
+	// other schemas still use built-in types
+	if got := GuessFlowControlSchemaType(newMaxInflightSchema(10)); got != proxyv1alpha1.MaxRequestsInflight {
+		t.Errorf("GuessFlowControlSchemaType() = %v, want %v", got, proxyv1alpha1.MaxRequestsInflight)
+	}
+
+	if err := RegisterFactory(typ, match, factory); err == nil {
+		t.Errorf("RegisterFactory() should return error on duplicate registration")
+	}
+	if err := RegisterFactory(proxyv1alpha1.TokenBucket, match, factory); err == nil {
+		t.Errorf("RegisterFactory() should return error on built-in type")
+	}
+	if err := RegisterFactory("TestRegisterNilFactory", match, nil); err == nil {
+		t.Errorf("RegisterFactory() should return error on nil factory")
+	}
+	if err := RegisterFactory("TestRegisterNilMatcher", nil, factory); err == nil {
+		t.Errorf("RegisterFactory() should return error on nil matcher")
+	}
+}
+
+func TestFlowControl_TryAcquireDetailed(t *testing.T) {
+	tests := []struct {
+		name string
+		fc   FlowControl
+		want RejectReason
+	}{
+		{
+			name: "max inflight",
+			fc:   NewFlowControl(newMaxInflightSchema(0)),
+			want: LocalInflightExceeded,
+		},
+		{
+			name: "token bucket",
+			fc:   NewFlowControl(newTokenBucketSchema(0, 0)),
+			want: LocalRateExceeded,
+		},
+		{
+			name: "composite",
+			fc:   NewCompositeFlowControl("and", CompositeAnd, NewFlowControl(newMaxInflightSchema(1)), NewFlowControl(newTokenBucketSchema(0, 0))),
+			want: LocalRateExceeded,
+		},
+	}
+	for i := range tests {
+		tt := tests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			ok, reason := tt.fc.TryAcquireDetailed()
+			if ok || reason != tt.want {
+				t.Errorf("TryAcquireDetailed() = (%v, %v), want (false, %v)", ok, reason, tt.want)
+			}
+			if got := tt.fc.Reserve().Reason(); got != tt.want {
+				t.Errorf("Reserve().Reason() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowControl_Configured(t *testing.T) {
+	tb := NewFlowControl(newTokenBucketSchema(10, 20))
+	tb.Resize(30, 40)
+	if qps, ok := tb.ConfiguredQPS(); !ok || qps != 30 {
+		t.Errorf("ConfiguredQPS() = (%v, %v), want (30, true)", qps, ok)
+	}
+	if burst, ok := tb.ConfiguredBurst(); !ok || burst != 40 {
+		t.Errorf("ConfiguredBurst() = (%v, %v), want (40, true)", burst, ok)
+	}
+	if _, ok := tb.ConfiguredMaxInflight(); ok {
+		t.Errorf("ConfiguredMaxInflight() of token bucket should not be ok")
+	}
+
+	mi := NewFlowControl(newMaxInflightSchema(10))
+	mi.Resize(20, 0)
+	if max, ok := mi.ConfiguredMaxInflight(); !ok || max != 20 {
+		t.Errorf("ConfiguredMaxInflight() = (%v, %v), want (20, true)", max, ok)
+	}
+	if _, ok := mi.ConfiguredQPS(); ok {
+		t.Errorf("ConfiguredQPS() of max inflight should not be ok")
+	}
+
+	exempt := NewFlowControl(proxyv1alpha1.FlowControlSchema{Name: "exempt"})
+	if _, ok := exempt.ConfiguredMaxInflight(); ok {
+		t.Errorf("ConfiguredMaxInflight() of exempt should not be ok")
+	}
+}
+
+func TestNewFlowControl_Options(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		burst  uint32
+		before int32
+		after  int32
+	}{
+		{
+			name:   "default starts full",
+			burst:  20,
+			before: 10,
+			after:  10,
+		},
+		{
+			name:   "half filled",
+			opts:   []Option{WithInitialFill(0.5)},
+			burst:  20,
+			before: 5,
+			after:  5,
+		},
+		{
+			name:   "top up on growth",
+			opts:   []Option{WithInitialFill(0), WithTopUpOnGrowth()},
+			burst:  20,
+			before: 0,
+			after:  20,
+		},
+	}
+	for i := range tests {
+		tt := tests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			fc := NewFlowControl(newTokenBucketSchema(0, 10), tt.opts...)
+			if got := fc.Available(); got != tt.before {
+				t.Errorf("Available() before resize = %v, want %v", got, tt.before)
+			}
+			fc.Resize(0, tt.burst)
+			if got := fc.Available(); got != tt.after {
+				t.Errorf("Available() after resize = %v, want %v", got, tt.after)
+			}
+		})
+	}
+}
+
+func TestFlowControl_OverRelease(t *testing.T) {
+	unmatched := 0
+	fc := NewFlowControl(newMaxInflightSchema(2), WithUnmatchedReleaseHandler(func(name string) {
+		if name != "max-inflight" {
+			t.Errorf("unmatched release handler got name %q, want %q", name, "max-inflight")
+		}
+		unmatched++
+	}))
+	fc.TryAcquire()
+	for i := 0; i < 3; i++ {
+		fc.Release()
+	}
+	if got := fc.Available(); got != 2 {
+		t.Errorf("Available() after over-release = %v, want 2", got)
+	}
+	if unmatched != 2 {
+		t.Errorf("unmatched releases = %v, want 2", unmatched)
+	}
+	admitted := 0
+	for i := 0; i < 4; i++ {
+		if fc.TryAcquire() {
+			admitted++
+		}
+	}
+	if admitted != 2 {
+		t.Errorf("admitted %v requests after over-release, want 2", admitted)
+	}
+}
+
+func TestNormalizeLimit(t *testing.T) {
+	tests := []struct {
+		value int32
+		want  uint32
+	}{
+		{value: -1, want: 0},
+		{value: math.MinInt32, want: 0},
+		{value: 0, want: 0},
+		{value: 10, want: 10},
+		{value: math.MaxInt32, want: math.MaxInt32},
+	}
+	for _, tt := range tests {
+		if got := NormalizeLimit(tt.value); got != tt.want {
+			t.Errorf("NormalizeLimit(%v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	// negative limits block all requests instead of wrapping around
+	for _, schema := range []proxyv1alpha1.FlowControlSchema{newMaxInflightSchema(-1), newTokenBucketSchema(-1, -1)} {
+		fc := NewFlowControl(schema)
+		if fc.TryAcquire() {
+			t.Errorf("flowcontrol %v with negative limit should reject requests", fc.String())
+		}
+	}
+}
+
+func TestReservation_Release(t *testing.T) {
+	old := NewFlowControl(newMaxInflightSchema(1))
+	r := old.Reserve()
+	if r.Release() {
+		t.Errorf("Release() before Commit() should return false")
+	}
+	r.Commit()
+	if !r.Release() {
+		t.Errorf("Release() after Commit() should return true")
+	}
+	if r.Release() {
+		t.Errorf("Release() twice should return false")
+	}
+	if got := old.Available(); got != 1 {
+		t.Errorf("Available() = %v, want 1", got)
+	}
+
+	// Release releases the exact child admitting the request in Or mode
+	first := NewFlowControl(newMaxInflightSchema(1))
+	second := NewFlowControl(newMaxInflightSchema(1))
+	fc := NewCompositeFlowControl("or", CompositeOr, first, second)
+	r1 := fc.Reserve()
+	r1.Commit()
+	r2 := fc.Reserve()
+	r2.Commit()
+	r2.Release()
+	if first.Available() != 0 || second.Available() != 1 {
+		t.Errorf("Release() should release the second child, got first=%v, second=%v", first.Available(), second.Available())
+	}
+}
+
+func TestTokenBucket_Warmup(t *testing.T) {
+	start := time.Now()
+	b := &tokenBucket{qps: 10, warmup: 10 * time.Second, rampStart: start, rampFrom: 0}
+	tests := []struct {
+		name     string
+		from, to time.Duration
+		want     float64
+	}{
+		{"first half of ramp", 0, 5 * time.Second, 12.5},
+		{"whole ramp", 0, 10 * time.Second, 50},
+		{"across ramp end", 5 * time.Second, 15 * time.Second, 37.5 + 50},
+		{"after ramp", 10 * time.Second, 20 * time.Second, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.accruedLocked(start.Add(tt.from), start.Add(tt.to)); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("accruedLocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	fc := NewFlowControl(newTokenBucketSchema(1, 1), WithWarmup(time.Hour))
+	if fc.WarmingUp() {
+		t.Errorf("WarmingUp() should be false before resize")
+	}
+	fc.Resize(100, 1)
+	if !fc.WarmingUp() {
+		t.Errorf("WarmingUp() should be true after qps increases")
+	}
+	fc.Resize(10, 1)
+	if fc.WarmingUp() {
+		t.Errorf("WarmingUp() should be false after qps decreases")
+	}
+
+	fc = NewFlowControl(newTokenBucketSchema(1, 1))
+	fc.Resize(100, 1)
+	if fc.WarmingUp() {
+		t.Errorf("WarmingUp() should be false without warmup")
+	}
+}
+
+func TestFlowControls_Range(t *testing.T) {
+	fls := NewFlowControls()
+	fls.Store("a", NewFlowControl(newMaxInflightSchema(1)))
+	fls.Store("b", NewFlowControl(newTokenBucketSchema(1, 1)))
+
+	seen := map[string]bool{}
+	fls.Range(func(name string, fl FlowControl) bool {
+		seen[name] = true
+		// fn can call back into FlowControls without deadlock
+		fls.Delete(name)
+		return true
+	})
+	if len(seen) != 2 || !seen["a"] || !seen["b"] {
+		t.Errorf("Range() visited %v, want a and b", seen)
+	}
+	if fls.Len() != 0 {
+		t.Errorf("Len() = %v, want 0", fls.Len())
+	}
+
+	fls.Store("a", NewFlowControl(newMaxInflightSchema(1)))
+	fls.Store("b", NewFlowControl(newMaxInflightSchema(1)))
+	count := 0
+	fls.Range(func(name string, fl FlowControl) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("Range() should stop when fn returns false, visited %v", count)
+	}
+}
+
+func TestTokenBucket_Clock(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	fc := NewFlowControl(newTokenBucketSchema(2, 10), WithClock(fakeClock), WithInitialFill(0))
+	if got := fc.Available(); got != 0 {
+		t.Errorf("Available() = %v, want 0", got)
+	}
+	fakeClock.Step(time.Second)
+	if got := fc.Available(); got != 2 {
+		t.Errorf("Available() after 1s = %v, want 2", got)
+	}
+	fakeClock.Step(10 * time.Second)
+	if got := fc.Available(); got != 10 {
+		t.Errorf("Available() after 11s = %v, want burst 10", got)
+	}
+
+	// qps ramps from 0 to 10 in 10s, so 50 tokens are refilled during warmup
+	fc = NewFlowControl(newTokenBucketSchema(0, 100), WithClock(fakeClock), WithInitialFill(0), WithWarmup(10*time.Second))
+	fc.Resize(10, 100)
+	fakeClock.Step(5 * time.Second)
+	if got := fc.Available(); got != 12 {
+		t.Errorf("Available() in the middle of warmup = %v, want 12", got)
+	}
+	if !fc.WarmingUp() {
+		t.Errorf("WarmingUp() should be true in the middle of warmup")
+	}
+	fakeClock.Step(5 * time.Second)
+	if got := fc.Available(); got != 50 {
+		t.Errorf("Available() at the end of warmup = %v, want 50", got)
+	}
+	if fc.WarmingUp() {
+		t.Errorf("WarmingUp() should be false after warmup")
+	}
+	fakeClock.Step(time.Second)
+	if got := fc.Available(); got != 60 {
+		t.Errorf("Available() after warmup = %v, want 60", got)
+	}
+}
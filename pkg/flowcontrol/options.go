@@ -0,0 +1,105 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowcontrol
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Option configures a FlowControl created by NewFlowControl
+type Option func(*options)
+
+type options struct {
+	// initialFill is the fraction of burst which a new token bucket starts with
+	initialFill float64
+	// topUpOnGrowth fills a token bucket up to the new burst when it grows
+	topUpOnGrowth bool
+	// warmup is the duration in which a token bucket ramps up to a higher qps
+	warmup time.Duration
+	// clock drives token bucket refill
+	clock clock.Clock
+	// onUnmatchedRelease is called with the flow control name when a release
+	// without a matching acquire is ignored
+	onUnmatchedRelease func(name string)
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		// token bucket starts full by default
+		initialFill: 1,
+		clock:       clock.RealClock{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithInitialFill sets the fraction of burst, between 0 and 1, which a new
+// token bucket starts with. By default a token bucket starts full, so the
+// first burst of traffic is not throttled.
+func WithInitialFill(fraction float64) Option {
+	return func(o *options) {
+		switch {
+		case fraction < 0:
+			fraction = 0
+		case fraction > 1:
+			fraction = 1
+		}
+		o.initialFill = fraction
+	}
+}
+
+// WithTopUpOnGrowth fills a token bucket up to the new burst when Resize
+// grows it. By default tokens accrued so far are kept as they are.
+func WithTopUpOnGrowth() Option {
+	return func(o *options) {
+		o.topUpOnGrowth = true
+	}
+}
+
+// WithWarmup makes a token bucket ramp its qps up linearly from the old value
+// to the new one in the given duration when Resize increases qps, so that a
+// cold upstream is not overwhelmed. A decrease always takes effect
+// immediately. By default there is no warmup.
+func WithWarmup(d time.Duration) Option {
+	return func(o *options) {
+		if d < 0 {
+			d = 0
+		}
+		o.warmup = d
+	}
+}
+
+// WithClock sets the clock which drives token bucket refill and warmup, so
+// tests can control time with a fake clock. By default the real clock is used.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		if c != nil {
+			o.clock = c
+		}
+	}
+}
+
+// WithUnmatchedReleaseHandler sets a function which is called with the flow
+// control name when Release is called without a matching acquire, e.g. to
+// record a metric. The release itself is ignored.
+func WithUnmatchedReleaseHandler(fn func(name string)) Option {
+	return func(o *options) {
+		o.onUnmatchedRelease = fn
+	}
+}
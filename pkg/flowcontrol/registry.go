@@ -0,0 +1,94 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowcontrol
+
+import (
+	"fmt"
+	"sync"
+
+	proxyv1alpha1 "github.com/kubewharf/kubegateway/pkg/apis/proxy/v1alpha1"
+)
+
+// Factory creates a FlowControl from schema, opts are the options given to
+// NewFlowControl.
+type Factory func(schema proxyv1alpha1.FlowControlSchema, opts ...Option) FlowControl
+
+// Matcher returns true if schema is of a registered type. The schema has no
+// field to carry a custom type name, so the registered type identifies its
+// schemas itself, e.g. by schema name.
+type Matcher func(schema proxyv1alpha1.FlowControlSchema) bool
+
+type registeredType struct {
+	typ     proxyv1alpha1.FlowControlSchemaType
+	match   Matcher
+	factory Factory
+}
+
+var (
+	registryLock sync.RWMutex
+	// registered types in registration order, the first match wins
+	registeredTypes []registeredType
+)
+
+// RegisterFactory registers a custom schema type. GuessFlowControlSchemaType
+// returns typ for schemas accepted by match before checking built-in types,
+// and NewFlowControl creates them by factory. A factory must not pass a
+// schema accepted by match back to NewFlowControl.
+// It returns an error if typ is a built-in type or is already registered.
+func RegisterFactory(typ proxyv1alpha1.FlowControlSchemaType, match Matcher, factory Factory) error {
+	if match == nil || factory == nil {
+		return fmt.Errorf("flowcontrol matcher or factory for type %q is nil", typ)
+	}
+	switch typ {
+	case proxyv1alpha1.Unknown, proxyv1alpha1.Exempt, proxyv1alpha1.MaxRequestsInflight, proxyv1alpha1.TokenBucket:
+		return fmt.Errorf("flowcontrol type %q is built-in and can not be registered", typ)
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, r := range registeredTypes {
+		if r.typ == typ {
+			return fmt.Errorf("flowcontrol factory for type %q is already registered", typ)
+		}
+	}
+	registeredTypes = append(registeredTypes, registeredType{typ: typ, match: match, factory: factory})
+	return nil
+}
+
+// matchRegisteredType returns the registered type which accepts schema.
+// Matchers are called without holding the lock.
+func matchRegisteredType(schema proxyv1alpha1.FlowControlSchema) (registeredType, bool) {
+	registryLock.RLock()
+	types := registeredTypes
+	registryLock.RUnlock()
+	for _, r := range types {
+		if r.match(schema) {
+			return r, true
+		}
+	}
+	return registeredType{}, false
+}
+
+// unregisterFactory removes a registered type, it is used by tests.
+func unregisterFactory(typ proxyv1alpha1.FlowControlSchemaType) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	types := make([]registeredType, 0, len(registeredTypes))
+	for _, r := range registeredTypes {
+		if r.typ != typ {
+			types = append(types, r)
+		}
+	}
+	registeredTypes = types
+}
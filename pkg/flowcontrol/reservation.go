@@ -0,0 +1,119 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowcontrol
+
+import (
+	"sync/atomic"
+)
+
+// Reservation holds a token taken by FlowControl.Reserve until the caller
+// knows whether the request will actually be forwarded to upstream.
+type Reservation interface {
+	// OK returns true if a token is taken.
+	OK() bool
+	// Commit finalizes the reservation. Release must be called after the
+	// request is finished.
+	Commit()
+	// Cancel gives the token back as if it is never acquired.
+	// Release must not be called after Cancel.
+	Cancel()
+	// Release releases the token against the flow control which admitted
+	// the request, even if the flow control is replaced later. It only takes
+	// effect once after Commit, and returns false otherwise.
+	Release() bool
+	// Reason returns why the reservation is rejected, it is empty if OK.
+	Reason() RejectReason
+}
+
+// RejectReason describes why a flow control rejects a request
+type RejectReason string
+
+const (
+	NotRejected           RejectReason = ""
+	LocalRateExceeded     RejectReason = "LocalRateExceeded"
+	LocalInflightExceeded RejectReason = "LocalInflightExceeded"
+	// ReservationRequired is returned by TryAcquire of flow controls which
+	// can only admit requests by Reserve, e.g. composite flow control in Or mode
+	ReservationRequired RejectReason = "ReservationRequired"
+)
+
+const (
+	reservationPending int32 = iota
+	reservationCommitted
+	reservationCanceled
+	reservationReleased
+)
+
+var (
+	rateExceededReservation     Reservation = &reservation{reason: LocalRateExceeded}
+	inflightExceededReservation Reservation = &reservation{reason: LocalInflightExceeded}
+)
+
+type reservation struct {
+	ok     bool
+	reason RejectReason
+	state  int32
+	// hooks called on state transitions, nil means nothing to do
+	commit  func()
+	cancel  func()
+	release func()
+}
+
+func newReservation(cancel, release func()) *reservation {
+	return &reservation{
+		ok:      true,
+		cancel:  cancel,
+		release: release,
+	}
+}
+
+func (r *reservation) OK() bool {
+	return r.ok
+}
+
+func (r *reservation) Reason() RejectReason {
+	return r.reason
+}
+
+func (r *reservation) Commit() {
+	if !r.ok {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&r.state, reservationPending, reservationCommitted) && r.commit != nil {
+		r.commit()
+	}
+}
+
+func (r *reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&r.state, reservationPending, reservationCanceled) && r.cancel != nil {
+		r.cancel()
+	}
+}
+
+func (r *reservation) Release() bool {
+	if !r.ok {
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&r.state, reservationCommitted, reservationReleased) {
+		return false
+	}
+	if r.release != nil {
+		r.release()
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowcontrol
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// tokenBucket is a token bucket rate limiter which refills qps tokens per
+// second up to burst tokens. Unlike the rate limiter in client-go, tokens
+// can be given back to the bucket, so an admitted request that is never
+// forwarded does not waste quota.
+type tokenBucket struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// warmup is the duration in which qps ramps up linearly from rampFrom
+	// after an increase, no ramp if it is 0
+	warmup time.Duration
+	// rampStart is zero if there is no ramp in progress
+	rampStart time.Time
+	rampFrom  float64
+}
+
+// newTokenBucket returns a token bucket which starts with initialFill of
+// burst tokens. A full bucket behaves the same as
+// flowcontrol.NewTokenBucketRateLimiter in client-go.
+func newTokenBucket(qps float64, burst int, o *options) *tokenBucket {
+	return &tokenBucket{
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst) * o.initialFill,
+		clock:  o.clock,
+		last:   o.clock.Now(),
+		warmup: o.warmup,
+	}
+}
+
+// qpsAtLocked returns the effective qps at t, which is lower than qps
+// during warmup.
+func (b *tokenBucket) qpsAtLocked(t time.Time) float64 {
+	if b.rampStart.IsZero() || !t.Before(b.rampStart.Add(b.warmup)) {
+		return b.qps
+	}
+	if t.Before(b.rampStart) {
+		return b.rampFrom
+	}
+	progress := t.Sub(b.rampStart).Seconds() / b.warmup.Seconds()
+	return b.rampFrom + (b.qps-b.rampFrom)*progress
+}
+
+// accruedLocked returns tokens refilled between from and to. The effective
+// qps is linear during warmup and constant after it, so the ramp part is
+// integrated as a trapezoid.
+func (b *tokenBucket) accruedLocked(from, to time.Time) float64 {
+	if b.rampStart.IsZero() {
+		return to.Sub(from).Seconds() * b.qps
+	}
+	rampEnd := b.rampStart.Add(b.warmup)
+	if !from.Before(rampEnd) {
+		return to.Sub(from).Seconds() * b.qps
+	}
+	mid := to
+	if rampEnd.Before(to) {
+		mid = rampEnd
+	}
+	tokens := mid.Sub(from).Seconds() * (b.qpsAtLocked(from) + b.qpsAtLocked(mid)) / 2
+	tokens += to.Sub(mid).Seconds() * b.qps
+	return tokens
+}
+
+// advanceLocked refills tokens accrued since last update.
+func (b *tokenBucket) advanceLocked(now time.Time) {
+	if !now.After(b.last) {
+		return
+	}
+	b.tokens += b.accruedLocked(b.last, now)
+	b.last = now
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	if !b.rampStart.IsZero() && !now.Before(b.rampStart.Add(b.warmup)) {
+		// warmup is finished
+		b.rampStart = time.Time{}
+	}
+}
+
+// TryAcquire takes a token if one is available immediately.
+func (b *tokenBucket) TryAcquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advanceLocked(b.clock.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Return gives a token back to the bucket, it never exceeds burst.
+func (b *tokenBucket) Return() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advanceLocked(b.clock.Now())
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Available returns the number of tokens which can be taken immediately.
+func (b *tokenBucket) Available() int32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advanceLocked(b.clock.Now())
+	return int32(b.tokens)
+}
+
+// SetQPS changes the refill rate, tokens accrued so far are kept. If warmup
+// is set, an increase ramps up linearly from the current effective qps, and
+// a decrease takes effect immediately.
+func (b *tokenBucket) SetQPS(qps float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	// settle tokens with the old rate first
+	b.advanceLocked(now)
+	current := b.qpsAtLocked(now)
+	if b.warmup > 0 && qps > current {
+		b.rampStart = now
+		b.rampFrom = current
+	} else {
+		b.rampStart = time.Time{}
+	}
+	b.qps = qps
+}
+
+// WarmingUp returns true if qps is still ramping up after an increase.
+func (b *tokenBucket) WarmingUp() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.rampStart.IsZero() && b.clock.Now().Before(b.rampStart.Add(b.warmup))
+}
+
+// SetBurst changes the capacity of bucket, tokens accrued so far are kept
+// unless they exceed the new burst.
+func (b *tokenBucket) SetBurst(burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advanceLocked(b.clock.Now())
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Fill fills the bucket up to burst.
+func (b *tokenBucket) Fill() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advanceLocked(b.clock.Now())
+	b.tokens = b.burst
+}
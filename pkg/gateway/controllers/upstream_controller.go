@@ -35,6 +35,8 @@ import (
 	scheme "github.com/kubewharf/kubegateway/pkg/client/kubernetes/scheme"
 	proxylisters "github.com/kubewharf/kubegateway/pkg/client/listers/proxy/v1alpha1"
 	"github.com/kubewharf/kubegateway/pkg/clusters"
+	gatewayflowcontrol "github.com/kubewharf/kubegateway/pkg/flowcontrol"
+	"github.com/kubewharf/kubegateway/pkg/gateway/metrics"
 	gatewaynet "github.com/kubewharf/kubegateway/pkg/gateway/net"
 	"github.com/kubewharf/kubegateway/pkg/syncqueue"
 )
@@ -46,15 +48,18 @@ type UpstreamClusterController struct {
 	queue  *syncqueue.SyncQueue
 	lister proxylisters.UpstreamClusterLister
 	synced cache.InformerSynced
+	// options used to create flow controls of all clusters
+	flowControlOptions []gatewayflowcontrol.Option
 
 	clusters.Manager
 }
 
-func NewUpstreamClusterController(upstreamclusterinformer proxyinformers.UpstreamClusterInformer) *UpstreamClusterController {
+func NewUpstreamClusterController(upstreamclusterinformer proxyinformers.UpstreamClusterInformer, flowControlOptions ...gatewayflowcontrol.Option) *UpstreamClusterController {
 	m := &UpstreamClusterController{
-		lister:  upstreamclusterinformer.Lister(),
-		synced:  upstreamclusterinformer.Informer().HasSynced,
-		Manager: clusters.NewManager(),
+		lister:             upstreamclusterinformer.Lister(),
+		synced:             upstreamclusterinformer.Informer().HasSynced,
+		flowControlOptions: flowControlOptions,
+		Manager:            clusters.NewManager(),
 	}
 	m.queue = syncqueue.NewPassthroughSyncQueue(proxyv1alpha1.SchemeGroupVersion.WithKind("UpstreamCluster"), m.syncUpstreamCluster)
 
@@ -97,7 +102,7 @@ func (m *UpstreamClusterController) syncUpstreamCluster(obj interface{}) (syncqu
 
 	if !ok {
 		// bootstrap
-		clusterInfo, err := clusters.CreateClusterInfo(cluster, GatewayHealthCheck)
+		clusterInfo, err := clusters.CreateClusterInfo(cluster, GatewayHealthCheck, m.clusterFlowControlOptions(clusterName)...)
 		if err != nil {
 			klog.Errorf("failed to create cluster: %v, err: %v", cluster.Name, err)
 			return syncqueue.Result{RequeueAfter: 5 * time.Second, MaxRequeueTimes: 3}, nil
@@ -117,6 +122,15 @@ func (m *UpstreamClusterController) syncUpstreamCluster(obj interface{}) (syncqu
 	return syncqueue.Result{}, nil
 }
 
+// clusterFlowControlOptions returns options to create flow controls of the given cluster
+func (m *UpstreamClusterController) clusterFlowControlOptions(clusterName string) []gatewayflowcontrol.Option {
+	opts := make([]gatewayflowcontrol.Option, 0, len(m.flowControlOptions)+1)
+	opts = append(opts, m.flowControlOptions...)
+	return append(opts, gatewayflowcontrol.WithUnmatchedReleaseHandler(func(name string) {
+		metrics.RecordFlowControlUnmatchedRelease(clusterName, name)
+	}))
+}
+
 func (m *UpstreamClusterController) WrapGetConfigForClient(getConfigFunc dynamiccertificates.GetConfigForClientFunc) dynamiccertificates.GetConfigForClientFunc {
 	return func(clientHello *tls.ClientHelloInfo) (*tls.Config, error) {
 		baseTLSConfig, err := getConfigFunc(clientHello)
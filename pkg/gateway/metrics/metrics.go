@@ -132,6 +132,17 @@ var (
 		[]string{"pid", "serverName", "endpoint", "resource"},
 	)
 
+	proxyFlowControlUnmatchedReleases = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "flowcontrol_unmatched_releases_total",
+			Help:           "Number of flow control releases without a matching acquire.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"pid", "serverName", "flowcontrol"},
+	)
+
 	localMetrics = []compbasemetrics.Registerable{
 		proxyRequestCounter,
 		proxyRequestLatencies,
@@ -139,6 +150,7 @@ var (
 		proxyUpstreamUnhealthy,
 		proxyRequestTerminationsTotal,
 		proxyRegisteredWatchers,
+		proxyFlowControlUnmatchedReleases,
 	}
 )
 
@@ -212,6 +224,12 @@ func RecordProxyRequestTermination(req *http.Request, code int, reason string) {
 	proxyRequestTerminationsTotal.WithLabelValues(proxyPid, serverName, cleanVerb(verb, req), requestInfo.Path, codeToString(code), reason).Inc()
 }
 
+// RecordFlowControlUnmatchedRelease records that a flow control is released
+// without a matching acquire.
+func RecordFlowControlUnmatchedRelease(serverName, flowcontrol string) {
+	proxyFlowControlUnmatchedReleases.WithLabelValues(proxyPid, serverName, flowcontrol).Inc()
+}
+
 func RecordWatcherRegistered(serverName, endpoint, resource string) {
 	proxyRegisteredWatchers.WithLabelValues(proxyPid, serverName, endpoint, resource).Inc()
 }
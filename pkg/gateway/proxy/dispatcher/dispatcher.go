@@ -105,13 +105,23 @@ func (d *dispatcher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	flowcontrol := endpointPicker.FlowControl()
-	if !flowcontrol.TryAcquire() {
+	reservation := flowcontrol.Reserve()
+	if !reservation.OK() {
 		//TODO: exempt master request and long running request
 		// add metrics
-		d.responseError(errors.NewTooManyRequests(fmt.Sprintf("too many requests for cluster(%s), limited by flowControl(%v)", extraInfo.Hostname, flowcontrol.String()), retryAfter), w, req, statusReasonRateLimited)
+		d.responseError(errors.NewTooManyRequests(fmt.Sprintf("too many requests for cluster(%s), limited by flowControl(%v), reason: %v", extraInfo.Hostname, flowcontrol.String(), reservation.Reason()), retryAfter), w, req, statusReasonRateLimited)
 		return
 	}
-	defer flowcontrol.Release()
+	forwarded := false
+	defer func() {
+		if !forwarded {
+			// this request fails before being forwarded to upstream, give the token back
+			reservation.Cancel()
+			return
+		}
+		// release against the flow control which admitted this request
+		reservation.Release()
+	}()
 
 	endpoint, err := endpointPicker.Pop()
 	if err != nil {
@@ -135,6 +145,8 @@ func (d *dispatcher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		d.responseError(errors.NewInternalError(err), w, req, statusReasonInvalidRequestContext)
 		return
 	}
+	reservation.Commit()
+	forwarded = true
 
 	location := &url.URL{}
 	location.Scheme = ep.Scheme
@@ -0,0 +1,71 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kubegateway/pkg/flowcontrol"
+)
+
+type FlowControlOptions struct {
+	TokenBucketInitialFill   float64
+	TokenBucketTopUpOnGrowth bool
+	TokenBucketWarmup        time.Duration
+}
+
+func NewFlowControlOptions() *FlowControlOptions {
+	return &FlowControlOptions{
+		TokenBucketInitialFill:   1,
+		TokenBucketTopUpOnGrowth: false,
+		TokenBucketWarmup:        0,
+	}
+}
+
+func (o *FlowControlOptions) Validate() []error {
+	var errs []error
+	if o.TokenBucketInitialFill < 0 || o.TokenBucketInitialFill > 1 {
+		errs = append(errs, fmt.Errorf("--proxy-flowcontrol-token-bucket-initial-fill must be between 0 and 1, got %v", o.TokenBucketInitialFill))
+	}
+	if o.TokenBucketWarmup < 0 {
+		errs = append(errs, fmt.Errorf("--proxy-flowcontrol-token-bucket-warmup must not be negative, got %v", o.TokenBucketWarmup))
+	}
+	return errs
+}
+
+func (o *FlowControlOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.Float64Var(&o.TokenBucketInitialFill, "proxy-flowcontrol-token-bucket-initial-fill", o.TokenBucketInitialFill,
+		"The fraction of burst, between 0 and 1, which a new token bucket flow control starts with. "+
+			"A value below 1 rejects steady traffic right after a flow control changes from Exempt to TokenBucket, until tokens accrue.")
+	fs.BoolVar(&o.TokenBucketTopUpOnGrowth, "proxy-flowcontrol-token-bucket-top-up-on-growth", o.TokenBucketTopUpOnGrowth,
+		"Fill a token bucket flow control up to the new burst when its burst grows.")
+	fs.DurationVar(&o.TokenBucketWarmup, "proxy-flowcontrol-token-bucket-warmup", o.TokenBucketWarmup,
+		"The duration in which a token bucket flow control ramps up linearly to a higher qps. A decrease always takes effect immediately. 0 means no warmup.")
+}
+
+// ToFlowControlOptions returns options to create flow controls of upstream clusters
+func (o *FlowControlOptions) ToFlowControlOptions() []flowcontrol.Option {
+	opts := []flowcontrol.Option{
+		flowcontrol.WithInitialFill(o.TokenBucketInitialFill),
+		flowcontrol.WithWarmup(o.TokenBucketWarmup),
+	}
+	if o.TokenBucketTopUpOnGrowth {
+		opts = append(opts, flowcontrol.WithTopUpOnGrowth())
+	}
+	return opts
+}
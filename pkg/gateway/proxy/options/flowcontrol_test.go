@@ -0,0 +1,138 @@
+// Copyright 2022 ByteDance and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"testing"
+	"time"
+
+	proxyv1alpha1 "github.com/kubewharf/kubegateway/pkg/apis/proxy/v1alpha1"
+	"github.com/kubewharf/kubegateway/pkg/flowcontrol"
+)
+
+func TestFlowControlOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(o *FlowControlOptions)
+		wantErr int
+	}{
+		{
+			"default",
+			func(o *FlowControlOptions) {},
+			0,
+		},
+		{
+			"initial fill below 0",
+			func(o *FlowControlOptions) { o.TokenBucketInitialFill = -0.1 },
+			1,
+		},
+		{
+			"initial fill above 1",
+			func(o *FlowControlOptions) { o.TokenBucketInitialFill = 1.1 },
+			1,
+		},
+		{
+			"negative warmup",
+			func(o *FlowControlOptions) { o.TokenBucketWarmup = -time.Second },
+			1,
+		},
+		{
+			"all invalid",
+			func(o *FlowControlOptions) {
+				o.TokenBucketInitialFill = 2
+				o.TokenBucketWarmup = -time.Second
+			},
+			2,
+		},
+	}
+	for i := range tests {
+		tt := tests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewFlowControlOptions()
+			tt.modify(o)
+			if got := o.Validate(); len(got) != tt.wantErr {
+				t.Errorf("FlowControlOptions.Validate() = %v, want %v errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlowControlOptions_ToFlowControlOptions(t *testing.T) {
+	schema := proxyv1alpha1.FlowControlSchema{
+		Name: "tokenbucket",
+		FlowControlSchemaConfiguration: proxyv1alpha1.FlowControlSchemaConfiguration{
+			TokenBucket: &proxyv1alpha1.TokenBucketFlowControlSchema{
+				QPS:   0,
+				Burst: 10,
+			},
+		},
+	}
+	tests := []struct {
+		name string
+		o    *FlowControlOptions
+		// available tokens after creation
+		wantInitial int32
+		// available tokens after burst grows to 20
+		wantGrown int32
+		// whether increasing qps starts warmup
+		wantWarmup bool
+	}{
+		{
+			name:        "default",
+			o:           NewFlowControlOptions(),
+			wantInitial: 10,
+			wantGrown:   10,
+			wantWarmup:  false,
+		},
+		{
+			name:        "half initial fill",
+			o:           &FlowControlOptions{TokenBucketInitialFill: 0.5},
+			wantInitial: 5,
+			wantGrown:   5,
+			wantWarmup:  false,
+		},
+		{
+			name:        "top up on growth",
+			o:           &FlowControlOptions{TokenBucketInitialFill: 1, TokenBucketTopUpOnGrowth: true},
+			wantInitial: 10,
+			wantGrown:   20,
+			wantWarmup:  false,
+		},
+		{
+			name:        "warmup",
+			o:           &FlowControlOptions{TokenBucketInitialFill: 1, TokenBucketWarmup: time.Hour},
+			wantInitial: 10,
+			wantGrown:   10,
+			wantWarmup:  true,
+		},
+	}
+	for i := range tests {
+		tt := tests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			fc := flowcontrol.NewFlowControl(schema, tt.o.ToFlowControlOptions()...)
+			if got := fc.Available(); got != tt.wantInitial {
+				t.Errorf("Available() after creation = %v, want %v", got, tt.wantInitial)
+			}
+			fc.Resize(0, 20)
+			if got := fc.Available(); got != tt.wantGrown {
+				t.Errorf("Available() after burst grows = %v, want %v", got, tt.wantGrown)
+			}
+			fc.Resize(100, 20)
+			if got := fc.WarmingUp(); got != tt.wantWarmup {
+				t.Errorf("WarmingUp() after qps increases = %v, want %v", got, tt.wantWarmup)
+			}
+		})
+	}
+}